@@ -0,0 +1,83 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"go-server/pkg/errors"
+)
+
+// DecompressArray 圧縮されたデータを展開し、トップレベルのJSON配列を要素ごとにストリームデコードしてfnへ渡す
+// 配列全体をメモリに展開しないため、S3から取得した大きな圧縮ログ/イベントダンプの処理に向く
+// maxはストリーム全体の展開サイズ上限(0以下の場合はデフォルトの4MB)で、io.LimitedReaderにより強制される
+// 上限はストリーム全体に対してのみ適用され、要素単位のサイズ上限はない(内部のLimitedReaderはfnや呼び出し元へ公開されない)
+func DecompressArray[T any](data []byte, max int64, fn func(T) error) error {
+	if len(data) == 0 {
+		return errors.New(errors.InvalidParams, "data cannot be empty")
+	}
+
+	if fn == nil {
+		return errors.New(errors.InvalidParams, "fn cannot be nil")
+	}
+
+	if max <= 0 {
+		max = defaultMaxDecompressedSize
+	}
+
+	codec := detectCodec(data)
+
+	cr, err := codec.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, errors.InternalServerError, "failed to create %s reader", codec.Name())
+	}
+	defer cr.Close() // リソースリーク防止
+
+	lr := &io.LimitedReader{R: cr, N: max}
+	dec := json.NewDecoder(lr)
+
+	start, err := dec.Token()
+	if err != nil {
+		if lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to read JSON array start")
+	}
+	if delim, ok := start.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf(errors.InvalidParams, "expected top-level JSON array, got %v", start)
+	}
+
+	for dec.More() {
+		var elem T
+		if err := dec.Decode(&elem); err != nil {
+			if lr.N <= 0 {
+				return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", max)
+			}
+			return errors.Wrapf(err, errors.InternalServerError, "failed to decode JSON array element")
+		}
+
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+
+	// 配列終端の']'を読み切る
+	if _, err := dec.Token(); err != nil {
+		if lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to read JSON array end")
+	}
+
+	// データ整合性の検証
+	// ・配列終端後の未読データも必ずサイズ制限内で読み切る
+	// ・CRC/フッターの検証にはストリームを完全に読了する必要がある
+	if _, err := io.Copy(io.Discard, lr); err != nil {
+		if lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to verify complete %s stream", codec.Name())
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package compress
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressArray(t *testing.T) {
+	type elem struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	t.Run("empty data case", func(t *testing.T) {
+		err := DecompressArray(nil, 0, func(elem) error { return nil })
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "data cannot be empty"))
+	})
+
+	t.Run("nil fn case", func(t *testing.T) {
+		got, err := CompressWith(CodecGzip, []elem{{ID: 1, Name: "a"}})
+		assert.Exactly(t, nil, err)
+
+		err = DecompressArray[elem](got, 0, nil)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "fn cannot be nil"))
+	})
+
+	t.Run("round-trip case", func(t *testing.T) {
+		in := []elem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}}
+
+		got, err := CompressWith(CodecZstd, in)
+		assert.Exactly(t, nil, err)
+
+		var out []elem
+		err = DecompressArray(got, 0, func(e elem) error {
+			out = append(out, e)
+			return nil
+		})
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("not a top-level array case", func(t *testing.T) {
+		got, err := CompressWith(CodecGzip, elem{ID: 1, Name: "a"})
+		assert.Exactly(t, nil, err)
+
+		err = DecompressArray(got, 0, func(elem) error { return nil })
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "expected top-level JSON array"))
+	})
+
+	t.Run("fn error is propagated case", func(t *testing.T) {
+		in := []elem{{ID: 1, Name: "a"}}
+
+		got, err := CompressWith(CodecGzip, in)
+		assert.Exactly(t, nil, err)
+
+		err = DecompressArray(got, 0, func(elem) error {
+			return assert.AnError
+		})
+		assert.Exactly(t, assert.AnError, err)
+	})
+
+	t.Run("decompressed size exceeds limit case", func(t *testing.T) {
+		in := make([]elem, 100)
+		for i := range in {
+			in[i] = elem{ID: i, Name: strings.Repeat("x", 50)}
+		}
+
+		got, err := CompressWith(CodecGzip, in)
+		assert.Exactly(t, nil, err)
+
+		err = DecompressArray(got, 10, func(elem) error { return nil })
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "decompressed size exceeds limit: 10 bytes"))
+	})
+}
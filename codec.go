@@ -0,0 +1,163 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+
+	"go-server/pkg/errors"
+)
+
+// 各コーデックの識別名。CompressWithの引数や登録名として使用する
+const (
+	CodecGzip   = "gzip"
+	CodecZstd   = "zstd"
+	CodecBrotli = "brotli"
+	CodecLZ4    = "lz4"
+)
+
+// Codec 圧縮方式を抽象化するインターフェース
+// 新しい圧縮方式を追加する場合はこれを実装してregisterCodecで登録する
+type Codec interface {
+	// Name コーデックの識別名(CompressWithに渡す値と一致させる)
+	Name() string
+	// Magic デコード時にストリームの先頭バイト列から方式を判定するためのマジックバイト
+	Magic() []byte
+	// Encode wにエンコードしたデータを書き込むWriteCloserを返す
+	Encode(w io.Writer) io.WriteCloser
+	// Decode rからエンコード済みデータを読み出すReadCloserを返す
+	Decode(r io.Reader) (io.ReadCloser, error)
+}
+
+// codecsByName 登録済みコーデックの名前引き
+var codecsByName = map[string]Codec{}
+
+// codecsByMagic マジックバイト判定に使うコーデックを登録順に保持する(detectCodecはこの順に照合する)
+var codecsByMagic []Codec
+
+func registerCodec(c Codec) {
+	codecsByName[c.Name()] = c
+	codecsByMagic = append(codecsByMagic, c)
+}
+
+func init() {
+	registerCodec(gzipCodec{})
+	registerCodec(zstdCodec{})
+	registerCodec(brotliCodec{})
+	registerCodec(lz4Codec{})
+}
+
+// lookupCodec 名前からコーデックを取得する
+func lookupCodec(name string) (Codec, error) {
+	c, ok := codecsByName[name]
+	if !ok {
+		return nil, errors.Errorf(errors.InvalidParams, "unknown codec: %s", name)
+	}
+	return c, nil
+}
+
+// detectCodec 先頭バイト列(マジックバイト)からコーデックを判定する
+// Magic()が空を返すコーデック(固定ヘッダーを持たない形式)は自動判定の対象から除外される
+// 一致するものがない場合は従来挙動との互換のためgzipにフォールバックする
+func detectCodec(data []byte) Codec {
+	for _, c := range codecsByMagic {
+		magic := c.Magic()
+		if len(magic) == 0 {
+			continue
+		}
+		if len(data) >= len(magic) && bytesHasPrefix(data, magic) {
+			return c
+		}
+	}
+	return gzipCodec{}
+}
+
+func bytesHasPrefix(b, prefix []byte) bool {
+	if len(b) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if b[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// errWriteCloser コーデックの初期化に失敗した場合に、エラーをWrite/Close時まで遅延させて返すためのラッパー
+type errWriteCloser struct {
+	err error
+}
+
+func (e errWriteCloser) Write([]byte) (int, error) { return 0, e.err }
+func (e errWriteCloser) Close() error              { return e.err }
+
+// errReadCloser コーデックのデコーダ初期化エラーをio.ReadCloserとして表現するためのラッパー
+type errReadCloser struct {
+	err error
+}
+
+func (e errReadCloser) Read([]byte) (int, error) { return 0, e.err }
+func (e errReadCloser) Close() error             { return e.err }
+
+// gzipCodec 標準ライブラリのgzip実装
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string  { return CodecGzip }
+func (gzipCodec) Magic() []byte { return []byte{0x1f, 0x8b} }
+func (gzipCodec) Encode(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+func (gzipCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// zstdCodec klauspost/compress/zstdによる実装。gzip比で3〜5倍程度の圧縮率が見込める
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string  { return CodecZstd }
+func (zstdCodec) Magic() []byte { return []byte{0x28, 0xb5, 0x2f, 0xfd} }
+func (zstdCodec) Encode(w io.Writer) io.WriteCloser {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return errWriteCloser{err: errors.Wrapf(err, errors.InternalServerError, "failed to create zstd writer")}
+	}
+	return zw
+}
+func (zstdCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, errors.InternalServerError, "failed to create zstd reader")
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// brotliCodec andybalholm/brotliによる実装
+// brotliのストリーム形式(RFC 7932)には固定のマジックバイトが存在しない(先頭ビットはウィンドウサイズ等を
+// 符号化しており、ストリームごとに変わる)ため、Magic()はnilを返しdetectCodecでの自動判定の対象外とする。
+// brotliで圧縮したデータを読み戻す場合は、Decompress(自動判定)ではなくDecompressWith(CodecBrotli, ...)を使うこと
+type brotliCodec struct{}
+
+func (brotliCodec) Name() string  { return CodecBrotli }
+func (brotliCodec) Magic() []byte { return nil }
+func (brotliCodec) Encode(w io.Writer) io.WriteCloser {
+	return brotli.NewWriter(w)
+}
+func (brotliCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+// lz4Codec pierrec/lz4による実装
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string  { return CodecLZ4 }
+func (lz4Codec) Magic() []byte { return []byte{0x04, 0x22, 0x4d, 0x18} }
+func (lz4Codec) Encode(w io.Writer) io.WriteCloser {
+	return lz4.NewWriter(w)
+}
+func (lz4Codec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
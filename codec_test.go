@@ -0,0 +1,74 @@
+package compress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	type payload struct {
+		ID   int      `json:"id"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	in := payload{ID: 7, Name: "beta", Tags: []string{"a", "b", "c"}}
+
+	t.Run("gzip round-trip via auto-detect", func(t *testing.T) {
+		got, err := CompressWith(CodecGzip, in)
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, true, bytes.HasPrefix(got, gzipCodec{}.Magic()))
+
+		var out payload
+		assert.Exactly(t, nil, Decompress(got, &out, 0))
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("zstd round-trip via auto-detect", func(t *testing.T) {
+		got, err := CompressWith(CodecZstd, in)
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, true, bytes.HasPrefix(got, zstdCodec{}.Magic()))
+
+		var out payload
+		assert.Exactly(t, nil, Decompress(got, &out, 0))
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("lz4 round-trip via auto-detect", func(t *testing.T) {
+		got, err := CompressWith(CodecLZ4, in)
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, true, bytes.HasPrefix(got, lz4Codec{}.Magic()))
+
+		var out payload
+		assert.Exactly(t, nil, Decompress(got, &out, 0))
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("brotli round-trip requires explicit DecompressWith", func(t *testing.T) {
+		got, err := CompressWith(CodecBrotli, in)
+		assert.Exactly(t, nil, err)
+
+		// brotliには固定のマジックバイトがないため、自動判定はgzipにフォールバックし失敗する
+		var autoOut payload
+		err = Decompress(got, &autoOut, 0)
+		assert.Exactly(t, true, err != nil)
+
+		var out payload
+		assert.Exactly(t, nil, DecompressWith(CodecBrotli, got, &out, 0))
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("unknown codec case", func(t *testing.T) {
+		_, err := CompressWith("unknown", in)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "unknown codec: unknown"))
+
+		var out payload
+		err = DecompressWith("unknown", []byte{0x00}, &out, 0)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "unknown codec: unknown"))
+	})
+}
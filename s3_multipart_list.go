@@ -0,0 +1,197 @@
+package model
+
+import (
+	"context"
+	"go-server/domain/model"
+	"go-server/pkg/errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// InProgressUpload 進行中のマルチパートアップロード1件分の情報
+type InProgressUpload struct {
+	// Key アップロード先オブジェクトキー
+	Key string
+	// UploadID マルチパートアップロードID
+	UploadID string
+	// Initiated アップロード開始日時
+	Initiated time.Time
+}
+
+// ListMultipartParts アップロード済みパートの一覧を取得する
+// S3はPartNumberMarker/IsTruncatedによるページングを行うため、完了するまで内部でループする
+func (sp *s3Proxy) ListMultipartParts(ctx context.Context, bucket, key, uploadID string) ([]model.CompletedPart, error) {
+	var parts []model.CompletedPart
+	var marker *string
+
+	for {
+		out, err := sp.client.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           aws.String(bucket),
+			Key:              aws.String(key),
+			UploadId:         aws.String(uploadID),
+			PartNumberMarker: marker,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, errors.Storage, "failed to list parts(%s/%s) uploadID:%s", bucket, key, uploadID)
+		}
+
+		for _, p := range out.Parts {
+			parts = append(parts, model.CompletedPart{
+				PartNumber: aws.ToInt32(p.PartNumber),
+				ETag:       aws.ToString(p.ETag),
+			})
+		}
+
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			break
+		}
+		marker = out.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// ListInProgressMultipartUploads prefixに一致する進行中のマルチパートアップロード一覧を取得する
+// KeyMarker/UploadIdMarker/IsTruncatedによるページングを完了するまで内部でループする
+func (sp *s3Proxy) ListInProgressMultipartUploads(ctx context.Context, bucket, prefix string) ([]InProgressUpload, error) {
+	var uploads []InProgressUpload
+	var keyMarker, uploadIDMarker *string
+
+	for {
+		out, err := sp.client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         aws.String(bucket),
+			Prefix:         aws.String(prefix),
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, errors.Storage, "failed to list in-progress multipart uploads(%s) prefix:%s", bucket, prefix)
+		}
+
+		for _, u := range out.Uploads {
+			upload := InProgressUpload{
+				Key:      aws.ToString(u.Key),
+				UploadID: aws.ToString(u.UploadId),
+			}
+			if u.Initiated != nil {
+				upload.Initiated = *u.Initiated
+			}
+			uploads = append(uploads, upload)
+		}
+
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			break
+		}
+		keyMarker = out.NextKeyMarker
+		uploadIDMarker = out.NextUploadIdMarker
+	}
+
+	return uploads, nil
+}
+
+// PresignGetObject オブジェクト取得用の署名付きURLを発行する
+func (sp *s3Proxy) PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	presigner := s3.NewPresignClient(sp.client)
+
+	res, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", errors.Wrapf(err, errors.Storage, "failed to presign get object(%s/%s)", bucket, key)
+	}
+
+	return res.URL, nil
+}
+
+// PresignHeadObject オブジェクトのメタデータ取得用の署名付きURLを発行する
+func (sp *s3Proxy) PresignHeadObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	presigner := s3.NewPresignClient(sp.client)
+
+	res, err := presigner.PresignHeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", errors.Wrapf(err, errors.Storage, "failed to presign head object(%s/%s)", bucket, key)
+	}
+
+	return res.URL, nil
+}
+
+// AbortStaleUploads olderThanを超えて放置された進行中のマルチパートアップロードを列挙して中止する
+// 中止できたアップロード件数を返す。1件の中止に失敗した時点でそれまでの件数とエラーを返す
+func (sp *s3Proxy) AbortStaleUploads(ctx context.Context, bucket string, olderThan time.Duration) (int, error) {
+	uploads, err := sp.ListInProgressMultipartUploads(ctx, bucket, "")
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	aborted := 0
+
+	for _, u := range uploads {
+		if u.Initiated.IsZero() || u.Initiated.After(cutoff) {
+			continue
+		}
+
+		if err := sp.AbortMultipartUpload(ctx, bucket, u.Key, u.UploadID); err != nil {
+			return aborted, err
+		}
+		aborted++
+	}
+
+	return aborted, nil
+}
+
+func (s *S3TestSuite) Test_s3Proxy_ListAndPresign() {
+	ctx := context.Background()
+
+	s.Run("success case", func() {
+		uploadID, err := s.s3.CreateMultipartUpload(ctx, s.testBucket, "multipart/list.bin", nil)
+		s.NoError(err)
+
+		parts, err := s.s3.ListMultipartParts(ctx, s.testBucket, "multipart/list.bin", uploadID)
+		s.NoError(err)
+		s.Empty(parts)
+
+		uploads, err := s.s3.ListInProgressMultipartUploads(ctx, s.testBucket, "multipart/")
+		s.NoError(err)
+		s.NotEmpty(uploads)
+
+		getURL, err := s.s3.PresignGetObject(ctx, s.testBucket, "multipart/list.bin", time.Minute*15)
+		s.NoError(err)
+		s.NotEmpty(getURL)
+
+		headURL, err := s.s3.PresignHeadObject(ctx, s.testBucket, "multipart/list.bin", time.Minute*15)
+		s.NoError(err)
+		s.NotEmpty(headURL)
+
+		s.NoError(s.s3.AbortMultipartUpload(ctx, s.testBucket, "multipart/list.bin", uploadID))
+	})
+
+	s.Run("abort stale uploads case", func() {
+		aborted, err := s.s3.AbortStaleUploads(ctx, s.testBucket, time.Hour*24)
+		s.NoError(err)
+		s.GreaterOrEqual(aborted, 0)
+	})
+
+	s.Run("error case", func() {
+		_, err := s.s3.ListMultipartParts(ctx, "", "", "")
+		s.ErrorContains(err, "failed to list parts")
+
+		_, err = s.s3.ListInProgressMultipartUploads(ctx, "", "")
+		s.ErrorContains(err, "failed to list in-progress multipart uploads")
+
+		_, err = s.s3.PresignGetObject(ctx, "", "", time.Nanosecond)
+		s.ErrorContains(err, "failed to presign get object")
+
+		_, err = s.s3.PresignHeadObject(ctx, "", "", time.Nanosecond)
+		s.ErrorContains(err, "failed to presign head object")
+
+		_, err = s.s3.AbortStaleUploads(ctx, "", time.Hour)
+		s.ErrorContains(err, "failed to list in-progress multipart uploads")
+	})
+}
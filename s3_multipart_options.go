@@ -0,0 +1,160 @@
+package model
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+
+	"go-server/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SSEMode オブジェクトに適用するサーバサイド暗号化の方式
+type SSEMode string
+
+const (
+	// SSEModeNone 暗号化を指定しない(バケットのデフォルト設定に従う)
+	SSEModeNone SSEMode = ""
+	// SSEModeS3 SSE-S3(AES256、AWS管理キー)
+	SSEModeS3 SSEMode = "SSE-S3"
+	// SSEModeKMS SSE-KMS(AWS KMS管理キー。KMSKeyIDの指定が必要)
+	SSEModeKMS SSEMode = "SSE-KMS"
+	// SSEModeC SSE-C(クライアント提供キー。SSECustomerKeyの指定が必要)
+	SSEModeC SSEMode = "SSE-C"
+)
+
+// UploadOptions マルチパートアップロードの各操作に渡す付加情報
+// CreateMultipartUploadで設定した内容は、対象オブジェクトの全パートに対して一貫している必要がある
+type UploadOptions struct {
+	// SSEMode サーバサイド暗号化の方式
+	SSEMode SSEMode
+	// KMSKeyID SSEModeKMS使用時のKMSキーID(SSEModeKMSでは必須。空の場合はvalidateがエラーを返す)
+	KMSKeyID string
+	// SSECustomerKey SSEModeC使用時の256bit(32byte)客先提供キー
+	SSECustomerKey []byte
+	// StorageClass 保存するストレージクラス(未指定時はバケットのデフォルト)
+	StorageClass types.StorageClass
+	// ContentType オブジェクトのContent-Type
+	ContentType string
+	// Metadata オブジェクトに付与するユーザー定義メタデータ
+	Metadata map[string]string
+	// ContentEncoding オブジェクトのContent-Encodingヘッダーに設定する値
+	// MultipartUploader.Uploadで"gzip"を指定した場合のみ、アップロード前にpkg/compressで本文を圧縮する
+	// (CreateMultipartUpload等へ直接渡した場合はヘッダーが設定されるだけで、本文は圧縮されない)
+	ContentEncoding string
+}
+
+// validate UploadOptionsの整合性を検証する
+func (o *UploadOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+
+	if o.SSEMode == SSEModeKMS && o.KMSKeyID == "" {
+		return errors.New(errors.InvalidParams, "KMSKeyID is required for SSE-KMS")
+	}
+
+	if o.SSEMode == SSEModeC && len(o.SSECustomerKey) != 32 {
+		return errors.New(errors.InvalidParams, "SSECustomerKey must be a 32-byte key for SSE-C")
+	}
+
+	return nil
+}
+
+// fingerprint SSEパラメータの組み合わせを比較可能な値として表す
+// CompleteMultipartUploadで全パートが同一のSSE設定でアップロードされたことを検証するために使う
+func (o *UploadOptions) fingerprint() string {
+	if o == nil {
+		return string(SSEModeNone)
+	}
+
+	switch o.SSEMode {
+	case SSEModeKMS:
+		return string(SSEModeKMS) + ":" + o.KMSKeyID
+	case SSEModeC:
+		return string(SSEModeC) + ":" + base64.StdEncoding.EncodeToString(o.SSECustomerKey)
+	default:
+		return string(o.SSEMode)
+	}
+}
+
+// validatePartsSSEConsistency partOpts(パート番号ごとに実際に使われたSSE設定)がoptsと一致することを検証する
+// partOptsがnilの場合は、呼び出し元がパートごとのSSE設定を追跡していないとみなし検証をスキップする
+func validatePartsSSEConsistency(opts *UploadOptions, partOpts map[int32]*UploadOptions) error {
+	if partOpts == nil {
+		return nil
+	}
+
+	want := opts.fingerprint()
+	for partNumber, po := range partOpts {
+		if po.fingerprint() != want {
+			return errors.Errorf(errors.InvalidParams,
+				"part %d was uploaded with different SSE parameters than the rest of the upload", partNumber)
+		}
+	}
+
+	return nil
+}
+
+// applyToCreate CreateMultipartUploadInputへオプションを反映する
+func (o *UploadOptions) applyToCreate(in *s3.CreateMultipartUploadInput) {
+	if o == nil {
+		return
+	}
+
+	if o.StorageClass != "" {
+		in.StorageClass = o.StorageClass
+	}
+	if o.ContentType != "" {
+		in.ContentType = aws.String(o.ContentType)
+	}
+	if len(o.Metadata) > 0 {
+		in.Metadata = o.Metadata
+	}
+	if o.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(o.ContentEncoding)
+	}
+
+	o.applySSE(in)
+}
+
+// applySSE CreateMultipartUploadInputへSSE関連のフィールドのみを反映する
+func (o *UploadOptions) applySSE(in *s3.CreateMultipartUploadInput) {
+	if o == nil {
+		return
+	}
+
+	switch o.SSEMode {
+	case SSEModeS3:
+		in.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case SSEModeKMS:
+		in.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		in.SSEKMSKeyId = aws.String(o.KMSKeyID)
+	case SSEModeC:
+		algo, key, md5 := sseCustomerHeaders(o.SSECustomerKey)
+		in.SSECustomerAlgorithm = aws.String(algo)
+		in.SSECustomerKey = aws.String(key)
+		in.SSECustomerKeyMD5 = aws.String(md5)
+	}
+}
+
+// applyToUploadPart UploadPartInputへSSE-Cのヘッダーを反映する
+// SSE-C使用時は全パートのアップロードに同一の客先提供キーを添える必要がある
+func (o *UploadOptions) applyToUploadPart(in *s3.UploadPartInput) {
+	if o == nil || o.SSEMode != SSEModeC {
+		return
+	}
+
+	algo, key, md5 := sseCustomerHeaders(o.SSECustomerKey)
+	in.SSECustomerAlgorithm = aws.String(algo)
+	in.SSECustomerKey = aws.String(key)
+	in.SSECustomerKeyMD5 = aws.String(md5)
+}
+
+// sseCustomerHeaders SSE-C用のアルゴリズム名・Base64キー・キーのMD5を算出する
+func sseCustomerHeaders(rawKey []byte) (algorithm, base64Key, keyMD5 string) {
+	sum := md5.Sum(rawKey)
+	return "AES256", base64.StdEncoding.EncodeToString(rawKey), base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,487 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-server/domain/model"
+	"go-server/pkg/compress"
+	"go-server/pkg/errors"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// minPartSize S3が許容するパートの最小サイズ(最終パートを除く)
+	minPartSize = 5 * 1024 * 1024
+	// maxPartSize 1パートあたりの上限サイズ
+	maxPartSize = 100 * 1024 * 1024
+	// defaultPartSize パートサイズ未指定時のデフォルト値
+	defaultPartSize = 8 * 1024 * 1024
+	// defaultConcurrency 同時アップロードするパート数のデフォルト値
+	defaultConcurrency = 4
+	// defaultMaxRetries パート単位のリトライ回数のデフォルト値
+	defaultMaxRetries = 3
+)
+
+// ProgressFunc アップロードの進捗を通知するコールバック
+// uploaded は完了済みパートの合計バイト数、total はその時点までに入力から読み込んだバイト数(入力全体のサイズは事前に取得しない)
+type ProgressFunc func(uploaded, total int64)
+
+// UploadState 中断したアップロードを再開するためのシリアライズ可能な状態
+type UploadState struct {
+	Bucket       string                `json:"bucket"`
+	Key          string                `json:"key"`
+	UploadID     string                `json:"uploadId"`
+	PartSize     int64                 `json:"partSize"`
+	Parts        []model.CompletedPart `json:"parts"`
+	SHA256Digest string                `json:"sha256Digest,omitempty"`
+}
+
+// SerializeUploadState UploadStateをJSON化する(永続化して後で再開するため)
+func SerializeUploadState(state *UploadState) ([]byte, error) {
+	if state == nil {
+		return nil, errors.New(errors.InvalidParams, "state cannot be nil")
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrapf(err, errors.InternalServerError, "failed to serialize upload state")
+	}
+
+	return b, nil
+}
+
+// DeserializeUploadState シリアライズされたアップロード状態を復元する
+func DeserializeUploadState(data []byte) (*UploadState, error) {
+	if len(data) == 0 {
+		return nil, errors.New(errors.InvalidParams, "data cannot be empty")
+	}
+
+	var state UploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrapf(err, errors.InternalServerError, "failed to deserialize upload state")
+	}
+
+	return &state, nil
+}
+
+// UploadResult ストリーミングアップロードの結果
+type UploadResult struct {
+	UploadID string
+	Parts    []model.CompletedPart
+	// SHA256 はアップロードした全パートを結合した内容から計算したエンドツーエンドの整合性ハッシュ
+	SHA256 string
+}
+
+// MultipartUploader io.Readerからの入力を分割し、ワーカープールで並列にマルチパートアップロードを行う
+type MultipartUploader struct {
+	sp          *s3Proxy
+	partSize    int64
+	concurrency int
+	maxRetries  int
+	onProgress  ProgressFunc
+}
+
+// NewMultipartUploader MultipartUploaderを生成する
+// partSize/concurrencyに0以下を指定した場合はデフォルト値が使用される
+func NewMultipartUploader(sp *s3Proxy, partSize int64, concurrency int) *MultipartUploader {
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if partSize > maxPartSize {
+		partSize = maxPartSize
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	return &MultipartUploader{
+		sp:          sp,
+		partSize:    partSize,
+		concurrency: concurrency,
+		maxRetries:  defaultMaxRetries,
+	}
+}
+
+// WithProgress 進捗コールバックを設定する
+func (u *MultipartUploader) WithProgress(fn ProgressFunc) *MultipartUploader {
+	u.onProgress = fn
+	return u
+}
+
+// partJob ワーカーに割り当てる1パート分の作業
+type partJob struct {
+	number int32
+	data   []byte
+}
+
+// partOutcome ワーカーからの結果
+type partOutcome struct {
+	part model.CompletedPart
+	size int64
+	err  error
+}
+
+// Upload r から読み込んだ内容をパート分割し、ワーカープールで並列アップロードする
+// 既にCreateMultipartUploadが完了している場合はresumeStateを渡すことで完了済みパートの送信をスキップできる
+// rには常に入力全体を先頭から与えること(レジューム時であっても、未送信分だけを渡すと以降のパート番号が
+// ずれて破損する)。スキップするパートも再読込した内容をMD5でS3側のETagと突き合わせて検証するため、
+// 内容が一致しない場合はresumeを拒否しエラーを返す(SHA256ダイジェストへ誤った内容を取り込まないため)
+// ただしSSE-KMS/SSE-CではETagが平文のMD5と一致しないため、スキップするパートの検証は行わない
+// opts.ContentEncodingに"gzip"を指定すると、読み込んだ内容をpkg/compressで圧縮しながらアップロードする
+func (u *MultipartUploader) Upload(ctx context.Context, bucket, key string, r io.Reader, resumeState *UploadState, opts *UploadOptions) (*UploadResult, error) {
+	if r == nil {
+		return nil, errors.New(errors.InvalidParams, "reader cannot be nil")
+	}
+
+	if opts != nil && opts.ContentEncoding == "gzip" {
+		r = gzipCompressingReader(r)
+	}
+
+	uploadID := ""
+	completed := map[int32]model.CompletedPart{}
+
+	if resumeState != nil {
+		if resumeState.Bucket != bucket || resumeState.Key != key {
+			return nil, errors.New(errors.InvalidParams, "resume state does not match bucket/key")
+		}
+		if resumeState.PartSize != u.partSize {
+			return nil, errors.Errorf(errors.InvalidParams,
+				"resume state part size (%d) does not match uploader part size (%d)", resumeState.PartSize, u.partSize)
+		}
+		uploadID = resumeState.UploadID
+
+		// シリアライズされた状態を鵜呑みにせず、ListPartsでS3側の実際のアップロード済みパートと突き合わせる
+		actualParts, err := u.sp.ListMultipartParts(ctx, bucket, key, uploadID)
+		if err != nil {
+			return nil, err
+		}
+		actual := make(map[int32]model.CompletedPart, len(actualParts))
+		for _, p := range actualParts {
+			actual[p.PartNumber] = p
+		}
+
+		for _, p := range resumeState.Parts {
+			ap, ok := actual[p.PartNumber]
+			if !ok || ap.ETag != p.ETag {
+				return nil, errors.Errorf(errors.InvalidParams,
+					"resume state part %d does not match S3 (ListParts); refusing to resume(%s/%s)", p.PartNumber, bucket, key)
+			}
+		}
+		completed = actual
+	} else {
+		id, err := u.sp.CreateMultipartUpload(ctx, bucket, key, opts)
+		if err != nil {
+			return nil, err
+		}
+		uploadID = id
+	}
+
+	jobs := make(chan partJob)
+	results := make(chan partOutcome)
+
+	var wg sync.WaitGroup
+	for i := 0; i < u.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if existing, ok := completed[job.number]; ok {
+					if err := verifySkippedPartETag(job.number, job.data, existing.ETag, opts); err != nil {
+						results <- partOutcome{part: existing, size: int64(len(job.data)), err: err}
+						continue
+					}
+					results <- partOutcome{part: existing, size: int64(len(job.data))}
+					continue
+				}
+				part, err := u.uploadPartWithRetry(ctx, bucket, key, uploadID, job.number, job.data, opts)
+				results <- partOutcome{part: part, size: int64(len(job.data)), err: err}
+			}
+		}()
+	}
+
+	digest := sha256.New()
+	var readErr error
+	var partCount int32
+	var uploaded int64
+	var total atomic.Int64
+
+	done := make(chan struct{})
+	failFast := make(chan struct{})
+	var failFastOnce sync.Once
+	var outcomes []partOutcome
+	var outcomeErr error
+	go func() {
+		defer close(done)
+		for o := range results {
+			if o.err != nil && outcomeErr == nil {
+				outcomeErr = o.err
+				failFastOnce.Do(func() { close(failFast) })
+			}
+			outcomes = append(outcomes, o)
+			if o.err == nil {
+				uploaded += o.size
+			}
+			if u.onProgress != nil {
+				u.onProgress(uploaded, total.Load())
+			}
+		}
+	}()
+
+	buf := make([]byte, u.partSize)
+readLoop:
+	for {
+		// 既にいずれかのパートが永続的に失敗している場合、無駄な読み込み・エンキューを止めて早期に中断する
+		select {
+		case <-failFast:
+			break readLoop
+		default:
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			partCount++
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			digest.Write(chunk)
+			total.Add(int64(n))
+			select {
+			case jobs <- partJob{number: partCount, data: chunk}:
+			case <-failFast:
+				break readLoop
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-done
+
+	if readErr != nil {
+		_ = u.sp.AbortMultipartUpload(ctx, bucket, key, uploadID)
+		return nil, errors.Wrapf(readErr, errors.InternalServerError, "failed to read input for multipart upload(%s/%s)", bucket, key)
+	}
+
+	if outcomeErr != nil {
+		_ = u.sp.AbortMultipartUpload(ctx, bucket, key, uploadID)
+		return nil, outcomeErr
+	}
+
+	parts := make([]model.CompletedPart, 0, len(outcomes))
+	partOpts := make(map[int32]*UploadOptions, len(outcomes))
+	for _, o := range outcomes {
+		parts = append(parts, o.part)
+		// MultipartUploaderは1回のUploadに対し単一のoptsしか受け付けないため、全パートが同じ設定になる
+		partOpts[o.part.PartNumber] = opts
+	}
+	// ワーカーの完了順で集めているため、S3の要求どおりパート番号の昇順に並べ替える
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	if err := u.sp.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts, opts, partOpts); err != nil {
+		return nil, err
+	}
+
+	return &UploadResult{
+		UploadID: uploadID,
+		Parts:    parts,
+		SHA256:   hex.EncodeToString(digest.Sum(nil)),
+	}, nil
+}
+
+// verifySkippedPartETag resumeで送信をスキップするパートについて、再読込した内容がS3に既にアップロード
+// 済みのものと一致することをMD5でETagと突き合わせて検証する
+// 一致しない場合、そのパートの内容をSHA256ダイジェストに取り込むと破損したまま成功扱いになってしまう
+func verifySkippedPartETag(partNumber int32, data []byte, etag string, opts *UploadOptions) error {
+	// SSE-KMS/SSE-CではS3側で暗号化されるため、返るETagは平文のMD5と一致しない(uploadPartと同様の理由)
+	if opts != nil && opts.SSEMode != SSEModeNone && opts.SSEMode != SSEModeS3 {
+		return nil
+	}
+
+	sum := md5.Sum(data)
+	localETag := fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+	if etag != localETag {
+		return errors.Errorf(errors.InvalidParams,
+			"resume part %d content does not match S3 ETag; refusing to resume with mismatched data", partNumber)
+	}
+
+	return nil
+}
+
+// uploadPartWithRetry 1パートをアップロードし、一時的なエラーは指数バックオフしながらリトライする
+func (u *MultipartUploader) uploadPartWithRetry(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte, opts *UploadOptions) (model.CompletedPart, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= u.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * 200 * time.Millisecond
+			select {
+			case <-ctx.Done():
+				return model.CompletedPart{}, errors.Wrapf(ctx.Err(), errors.Storage, "context done while retrying part %d(%s/%s)", partNumber, bucket, key)
+			case <-time.After(backoff):
+			}
+		}
+
+		part, err := u.sp.uploadPart(ctx, bucket, key, uploadID, partNumber, data, opts)
+		if err == nil {
+			return part, nil
+		}
+		lastErr = err
+	}
+
+	return model.CompletedPart{}, errors.Wrapf(lastErr, errors.Storage, "failed to upload part %d after %d attempts(%s/%s)", partNumber, u.maxRetries+1, bucket, key)
+}
+
+// gzipCompressingReader r の内容をpkg/compressでgzip圧縮しながら読み出すReaderを返す
+// パート分割の前段で本文全体を圧縮しておくことで、ContentEncoding:"gzip"のオブジェクトとしてアップロードできる
+func gzipCompressingReader(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+
+	go func() {
+		cw, err := compress.NewCompressWriter(pw)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(cw, r); err != nil {
+			_ = cw.Close()
+			_ = pw.CloseWithError(err)
+			return
+		}
+
+		if err := cw.Close(); err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+
+		_ = pw.Close()
+	}()
+
+	return pr
+}
+
+// uploadPart パート本文を実際にS3へ送信し、MD5を検証したうえでCompletedPartを返す
+func (sp *s3Proxy) uploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte, opts *UploadOptions) (model.CompletedPart, error) {
+	sum := md5.Sum(data)
+	localETag := fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+
+	input := &s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
+		Body:       bytes.NewReader(data),
+	}
+	opts.applyToUploadPart(input)
+
+	out, err := sp.client.UploadPart(ctx, input)
+	if err != nil {
+		return model.CompletedPart{}, errors.Wrapf(err, errors.Storage, "failed to upload part %d(%s/%s)", partNumber, bucket, key)
+	}
+
+	if out.ETag == nil {
+		return model.CompletedPart{}, errors.Errorf(errors.Storage, "empty ETag for part %d(%s/%s)", partNumber, bucket, key)
+	}
+
+	// SSE-KMS/SSE-CではS3側で暗号化されるため、返るETagは平文のMD5と一致しない
+	// 暗号化なし/SSE-S3の場合のみ、転送中の破損検知としてローカルMD5と突き合わせる
+	if (opts == nil || opts.SSEMode == SSEModeNone || opts.SSEMode == SSEModeS3) && *out.ETag != localETag {
+		return model.CompletedPart{}, errors.Errorf(errors.Storage, "ETag mismatch for part %d(%s/%s): expected %s, got %s", partNumber, bucket, key, localETag, *out.ETag)
+	}
+
+	return model.CompletedPart{PartNumber: partNumber, ETag: *out.ETag}, nil
+}
+
+func (s *S3TestSuite) Test_s3Proxy_MultipartUploader() {
+	ctx := context.Background()
+
+	s.Run("concurrent upload success case", func() {
+		u := NewMultipartUploader(s.s3, minPartSize, 3)
+
+		data := bytes.Repeat([]byte{0x41}, minPartSize*5+123)
+		var lastProgress int64
+		u = u.WithProgress(func(uploaded, total int64) {
+			lastProgress = uploaded
+		})
+
+		result, err := u.Upload(ctx, s.testBucket, "multipart/uploader-success.bin", bytes.NewReader(data), nil, nil)
+		s.NoError(err)
+		s.NotEmpty(result.UploadID)
+		s.Len(result.Parts, 6)
+
+		sum := sha256.Sum256(data)
+		s.Equal(hex.EncodeToString(sum[:]), result.SHA256)
+		s.Equal(int64(len(data)), lastProgress)
+	})
+
+	s.Run("resume round-trip case", func() {
+		key := "multipart/uploader-resume.bin"
+		part1Data := bytes.Repeat([]byte{0x42}, minPartSize)
+		part2Data := bytes.Repeat([]byte{0x43}, 100)
+		full := append(append([]byte{}, part1Data...), part2Data...)
+
+		uploadID, err := s.s3.CreateMultipartUpload(ctx, s.testBucket, key, nil)
+		s.NoError(err)
+
+		// 1パート目だけを先にアップロード済みの状態を作り、resumeStateでそれを再利用できることを検証する
+		part1, err := s.s3.uploadPart(ctx, s.testBucket, key, uploadID, 1, part1Data, nil)
+		s.NoError(err)
+
+		resumeState := &UploadState{
+			Bucket:   s.testBucket,
+			Key:      key,
+			UploadID: uploadID,
+			PartSize: minPartSize,
+			Parts:    []model.CompletedPart{part1},
+		}
+
+		u := NewMultipartUploader(s.s3, minPartSize, 2)
+		result, err := u.Upload(ctx, s.testBucket, key, bytes.NewReader(full), resumeState, nil)
+		s.NoError(err)
+		s.Len(result.Parts, 2)
+		s.Equal(part1.ETag, result.Parts[0].ETag)
+	})
+
+	s.Run("permanent part failure exhausts retries case", func() {
+		// 存在しないuploadIDに対するUploadPartはリトライしても永続的に失敗するため、
+		// uploadPartWithRetryがリトライを使い切ってエラーを返すことを検証する
+		u := NewMultipartUploader(s.s3, minPartSize, 1)
+		u.maxRetries = 0
+
+		_, err := u.uploadPartWithRetry(ctx, s.testBucket, "multipart/uploader-no-such-upload.bin", "no-such-upload-id", 1, []byte("data"), nil)
+		s.ErrorContains(err, "failed to upload part 1 after 1 attempts")
+
+		// resumeStateが指すuploadIDがS3側に存在しない場合、Uploadはワーカーを起動する前に
+		// ListMultipartPartsの時点でエラーを返し、中断された状態のままパートを送り続けない
+		resumeState := &UploadState{
+			Bucket:   s.testBucket,
+			Key:      "multipart/uploader-no-such-upload.bin",
+			UploadID: "no-such-upload-id",
+			PartSize: minPartSize,
+		}
+		_, err = u.Upload(ctx, s.testBucket, "multipart/uploader-no-such-upload.bin", bytes.NewReader([]byte("data")), resumeState, nil)
+		s.ErrorContains(err, "failed to list parts")
+	})
+}
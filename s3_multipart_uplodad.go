@@ -1,138 +1,190 @@
-package model
-
-import (
-	"context"
-	"go-server/domain/model"
-	"go-server/pkg/errors"
-	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-)
-
-// CompletedPart S3のマルチパートアップロードを完了する際の1パート分の情報を表す
-type CompletedPart struct {
-	// パート番号（1 から始まる連番）
-	PartNumber int32 `json:"partNumber"`
-	// アップロード後に S3 が返す ETag（完了処理時に必須）
-	ETag string `json:"eTag"`
-}
-
-// CreateMultipartUpload 開始する
-func (sp *s3Proxy) CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error) {
-	out, err := sp.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-
-	if err != nil {
-		return "", errors.Wrapf(err, errors.Storage, "failed to create multipart upload(%s/%s)", bucket, key)
-	}
-
-	if out.UploadId == nil {
-		return "", errors.Wrapf(nil, errors.Storage, "empty upload id(%s/%s)", bucket, key)
-	}
-
-	return *out.UploadId, nil
-}
-
-// PresignMultipartUploadPart 指定したパート用の署名付きURLを発行する
-func (sp *s3Proxy) PresignMultipartUploadPart(
-	ctx context.Context, bucket, key, uploadID string, partNumber int32, expires time.Duration) (string, error) {
-	presigner := s3.NewPresignClient(sp.client)
-
-	input := &s3.UploadPartInput{
-		Bucket:     aws.String(bucket),
-		Key:        aws.String(key),
-		UploadId:   aws.String(uploadID),
-		PartNumber: aws.Int32(partNumber),
-	}
-
-	res, err := presigner.PresignUploadPart(ctx, input, s3.WithPresignExpires(expires))
-	if err != nil {
-		return "", errors.Wrapf(err, errors.Storage, "failed to presign upload part(%s/%s) part:%d", bucket, key, partNumber)
-	}
-
-	return res.URL, nil
-}
-
-// CompleteMultipartUpload アップロードを完了する
-func (sp *s3Proxy) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []model.CompletedPart) error {
-	cps := make([]types.CompletedPart, 0, len(parts))
-	for _, p := range parts {
-		cps = append(cps, types.CompletedPart{
-			ETag:       aws.String(p.ETag),
-			PartNumber: aws.Int32(p.PartNumber),
-		})
-	}
-
-	_, err := sp.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(bucket),
-		Key:      aws.String(key),
-		UploadId: aws.String(uploadID),
-		MultipartUpload: &types.CompletedMultipartUpload{
-			Parts: cps,
-		},
-	})
-
-	if err != nil {
-		return errors.Wrapf(err, errors.Storage, "failed to complete multipart upload(%s/%s)", bucket, key)
-	}
-
-	return nil
-}
-
-// AbortMultipartUpload アップロードを取り消す
-func (sp *s3Proxy) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
-	_, err := sp.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-		Bucket:   aws.String(bucket),
-		Key:      aws.String(key),
-		UploadId: aws.String(uploadID),
-	})
-
-	if err != nil {
-		return errors.Wrapf(err, errors.Storage, "failed to abort multipart upload(%s/%s)", bucket, key)
-	}
-
-	return nil
-}
-
-func (s *S3TestSuite) Test_s3Proxy_MultipartUpload() {
-	ctx := context.Background()
-
-	s.Run("success case", func() {
-		// initiate
-		uploadID, err := s.s3.CreateMultipartUpload(ctx, s.testBucket, "multipart/test.bin")
-		s.NoError(err)
-		s.NotEmpty(uploadID)
-
-		// presign part 1
-		url, err := s.s3.PresignMultipartUploadPart(ctx, s.testBucket, "multipart/test.bin", uploadID, 1, time.Minute*15)
-		s.NoError(err)
-		s.NotEmpty(url)
-
-		// abort
-		s.NoError(s.s3.AbortMultipartUpload(ctx, s.testBucket, "multipart/test.bin", uploadID))
-	})
-
-	s.Run("error case", func() {
-		// invalid initiate
-		id, err := s.s3.CreateMultipartUpload(ctx, "", "")
-		s.Empty(id)
-		s.ErrorContains(err, "failed to create multipart upload")
-
-		// invalid presign
-		url, err := s.s3.PresignMultipartUploadPart(ctx, "", "", "", 0, time.Nanosecond)
-		s.ErrorContains(err, "failed to presign upload part")
-		s.Empty(url)
-
-		// invalid complete
-		err = s.s3.CompleteMultipartUpload(ctx, "", "", "", nil)
-		s.ErrorContains(err, "failed to complete multipart upload")
-
-		// invalid abort
-		err = s.s3.AbortMultipartUpload(ctx, "", "", "")
-		s.ErrorContains(err, "failed to abort multipart upload")
-	})
-}
+package model
+
+import (
+	"bytes"
+	"context"
+	"go-server/domain/model"
+	"go-server/pkg/errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// CompletedPart S3のマルチパートアップロードを完了する際の1パート分の情報を表す
+type CompletedPart struct {
+	// パート番号（1 から始まる連番）
+	PartNumber int32 `json:"partNumber"`
+	// アップロード後に S3 が返す ETag（完了処理時に必須）
+	ETag string `json:"eTag"`
+}
+
+// CreateMultipartUpload 開始する
+// optsでSSEやストレージクラス、圧縮ヒントなどを指定できる(省略時はnilで可)
+func (sp *s3Proxy) CreateMultipartUpload(ctx context.Context, bucket, key string, opts *UploadOptions) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	opts.applyToCreate(input)
+
+	out, err := sp.client.CreateMultipartUpload(ctx, input)
+
+	if err != nil {
+		return "", errors.Wrapf(err, errors.Storage, "failed to create multipart upload(%s/%s)", bucket, key)
+	}
+
+	if out.UploadId == nil {
+		return "", errors.Wrapf(nil, errors.Storage, "empty upload id(%s/%s)", bucket, key)
+	}
+
+	return *out.UploadId, nil
+}
+
+// PresignMultipartUploadPart 指定したパート用の署名付きURLを発行する
+// SSE-C使用時は、発行したURLへリクエストするクライアントも同じx-amz-server-side-encryption-customer-*ヘッダーを送る必要がある
+func (sp *s3Proxy) PresignMultipartUploadPart(
+	ctx context.Context, bucket, key, uploadID string, partNumber int32, expires time.Duration, opts *UploadOptions) (string, error) {
+	presigner := s3.NewPresignClient(sp.client)
+
+	input := &s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
+	}
+	opts.applyToUploadPart(input)
+
+	res, err := presigner.PresignUploadPart(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", errors.Wrapf(err, errors.Storage, "failed to presign upload part(%s/%s) part:%d", bucket, key, partNumber)
+	}
+
+	return res.URL, nil
+}
+
+// CompleteMultipartUpload アップロードを完了する
+// opts は CreateMultipartUpload に渡したものと同じ値を渡す
+// partOpts を渡すと、各パートが実際にどのSSE設定でアップロードされたかをoptsと突き合わせて検証する
+// (PresignMultipartUploadPartを複数回・異なるoptsで呼び出した場合の設定ミスを検出するためのもの。
+// 呼び出し元が追跡していない場合はnilで省略でき、その場合は検証をスキップする)
+func (sp *s3Proxy) CompleteMultipartUpload(
+	ctx context.Context, bucket, key, uploadID string, parts []model.CompletedPart, opts *UploadOptions, partOpts map[int32]*UploadOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if err := validatePartsSSEConsistency(opts, partOpts); err != nil {
+		return err
+	}
+
+	cps := make([]types.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		cps = append(cps, types.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int32(p.PartNumber),
+		})
+	}
+
+	_, err := sp.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: cps,
+		},
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, errors.Storage, "failed to complete multipart upload(%s/%s)", bucket, key)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload アップロードを取り消す
+func (sp *s3Proxy) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := sp.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, errors.Storage, "failed to abort multipart upload(%s/%s)", bucket, key)
+	}
+
+	return nil
+}
+
+func (s *S3TestSuite) Test_s3Proxy_MultipartUpload() {
+	ctx := context.Background()
+
+	s.Run("success case", func() {
+		// initiate
+		uploadID, err := s.s3.CreateMultipartUpload(ctx, s.testBucket, "multipart/test.bin", nil)
+		s.NoError(err)
+		s.NotEmpty(uploadID)
+
+		// presign part 1
+		url, err := s.s3.PresignMultipartUploadPart(ctx, s.testBucket, "multipart/test.bin", uploadID, 1, time.Minute*15, nil)
+		s.NoError(err)
+		s.NotEmpty(url)
+
+		// abort
+		s.NoError(s.s3.AbortMultipartUpload(ctx, s.testBucket, "multipart/test.bin", uploadID))
+	})
+
+	s.Run("sse-c case", func() {
+		opts := &UploadOptions{
+			SSEMode:        SSEModeC,
+			SSECustomerKey: bytes.Repeat([]byte{0x42}, 32),
+		}
+
+		uploadID, err := s.s3.CreateMultipartUpload(ctx, s.testBucket, "multipart/sse-c.bin", opts)
+		s.NoError(err)
+		s.NotEmpty(uploadID)
+
+		url, err := s.s3.PresignMultipartUploadPart(ctx, s.testBucket, "multipart/sse-c.bin", uploadID, 1, time.Minute*15, opts)
+		s.NoError(err)
+		s.NotEmpty(url)
+
+		s.NoError(s.s3.AbortMultipartUpload(ctx, s.testBucket, "multipart/sse-c.bin", uploadID))
+	})
+
+	s.Run("error case", func() {
+		// invalid initiate
+		id, err := s.s3.CreateMultipartUpload(ctx, "", "", nil)
+		s.Empty(id)
+		s.ErrorContains(err, "failed to create multipart upload")
+
+		// invalid presign
+		url, err := s.s3.PresignMultipartUploadPart(ctx, "", "", "", 0, time.Nanosecond, nil)
+		s.ErrorContains(err, "failed to presign upload part")
+		s.Empty(url)
+
+		// invalid complete
+		err = s.s3.CompleteMultipartUpload(ctx, "", "", "", nil, nil, nil)
+		s.ErrorContains(err, "failed to complete multipart upload")
+
+		// inconsistent per-part SSE settings
+		err = s.s3.CompleteMultipartUpload(ctx, s.testBucket, "multipart/test.bin", "upload-id",
+			[]model.CompletedPart{{PartNumber: 1, ETag: "etag"}},
+			&UploadOptions{SSEMode: SSEModeS3},
+			map[int32]*UploadOptions{1: {SSEMode: SSEModeC, SSECustomerKey: bytes.Repeat([]byte{0x42}, 32)}})
+		s.ErrorContains(err, "different SSE parameters")
+
+		// invalid SSE-KMS options
+		_, err = s.s3.CreateMultipartUpload(ctx, s.testBucket, "multipart/bad-kms.bin", &UploadOptions{SSEMode: SSEModeKMS})
+		s.ErrorContains(err, "KMSKeyID is required")
+
+		// invalid abort
+		err = s.s3.AbortMultipartUpload(ctx, "", "", "")
+		s.ErrorContains(err, "failed to abort multipart upload")
+	})
+}
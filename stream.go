@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"go-server/pkg/errors"
+)
+
+// Writer 圧縮データをストリームとして書き込むためのWriteCloser
+// Compressと異なり、入力全体をメモリに保持せずに逐次出力へ書き出す
+type Writer struct {
+	cw io.WriteCloser
+}
+
+// NewCompressWriter wへGZIP圧縮したデータを逐次書き込むWriterを生成する
+func NewCompressWriter(w io.Writer) (*Writer, error) {
+	if w == nil {
+		return nil, errors.New(errors.InvalidParams, "writer cannot be nil")
+	}
+
+	codec, err := lookupCodec(CodecGzip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{cw: codec.Encode(w)}, nil
+}
+
+// Write 圧縮前のバイト列を受け取り、コーデックへ逐次書き込む
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.cw.Write(p)
+}
+
+// Close 圧縮ストリームを確定する。フッターの書き込みとフラッシュが行われる
+func (w *Writer) Close() error {
+	return w.cw.Close()
+}
+
+// Reader 圧縮データをストリームとして読み出すためのReadCloser
+// Decompressと異なり、展開結果をメモリに溜め込まず逐次呼び出し元へ渡す
+type Reader struct {
+	cr        io.ReadCloser
+	lr        *io.LimitedReader
+	max       int64
+	codecName string
+}
+
+// NewDecompressReader rから圧縮データを読み出すReaderを生成する
+// 先頭バイト列からコーデックを自動判定するため、gzip/zstd/lz4のいずれも読める
+// brotliは固定のマジックバイトを持たないため自動判定できず、detectCodecはgzipにフォールバックする
+// maxが0以下の場合はデフォルトの制限(4MB)を使用する
+func NewDecompressReader(r io.Reader, max int64) (*Reader, error) {
+	if r == nil {
+		return nil, errors.New(errors.InvalidParams, "reader cannot be nil")
+	}
+
+	if max <= 0 {
+		max = defaultMaxDecompressedSize
+	}
+
+	// マジックバイト判定のためストリームを消費せずに先頭を覗き見る
+	br := bufio.NewReader(r)
+	peek, _ := br.Peek(4)
+	codec := detectCodec(peek)
+
+	cr, err := codec.Decode(br)
+	if err != nil {
+		return nil, errors.Wrapf(err, errors.InternalServerError, "failed to create %s reader", codec.Name())
+	}
+
+	return &Reader{
+		cr:        cr,
+		lr:        &io.LimitedReader{R: cr, N: max},
+		max:       max,
+		codecName: codec.Name(),
+	}, nil
+}
+
+// Read 展開後のバイト列をmaxで指定した上限まで読み出す
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.lr.Read(p)
+	if err != nil && err != io.EOF && r.lr.N <= 0 {
+		return n, errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", r.max)
+	}
+	return n, err
+}
+
+// Close 未読のデータを上限内で読み切ってCRC/フッターを検証したうえで、下位のコーデックリーダーを閉じる
+func (r *Reader) Close() error {
+	if _, err := io.Copy(io.Discard, r.lr); err != nil {
+		_ = r.cr.Close()
+		if r.lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", r.max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to verify complete %s stream", r.codecName)
+	}
+
+	return r.cr.Close()
+}
+
+// CompressStream srcをJSONエンコードしながらdstへ圧縮データをストリーム書き込みする
+// Compressと異なり、圧縮後データを[]byteとしてメモリに保持しない
+func CompressStream(dst io.Writer, src any) error {
+	if src == nil {
+		return errors.New(errors.InvalidParams, "data cannot be nil")
+	}
+
+	cw, err := NewCompressWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(cw).Encode(src); err != nil {
+		_ = cw.Close() // エラー時もリソースを確実に解放
+		return errors.Wrapf(err, errors.InternalServerError, "failed to encode JSON (type:%T)", src)
+	}
+
+	if err := cw.Close(); err != nil {
+		return errors.Wrapf(err, errors.InternalServerError, "failed to finalize compression")
+	}
+
+	return nil
+}
+
+// DecompressStream srcから圧縮データを読みつつJSONデコードし、dstへ書き込む
+// Decompressと異なり、圧縮データを[]byteで受け取らずio.Readerから逐次読み出す
+func DecompressStream(dst any, src io.Reader, max int64) error {
+	if dst == nil {
+		return errors.New(errors.InvalidParams, "output pointer cannot be nil")
+	}
+
+	r, err := NewDecompressReader(src, max)
+	if err != nil {
+		return err
+	}
+	defer r.cr.Close() // Close()は二重に呼ばないため、ここでは下位リーダーのみ解放する
+
+	if err := json.NewDecoder(r.lr).Decode(dst); err != nil {
+		if r.lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", r.max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to decode JSON")
+	}
+
+	// データ整合性の検証
+	// ・JSONデコード後の未読データも必ずサイズ制限内で読み切る
+	// ・CRC/フッターの検証にはストリームを完全に読了する必要がある
+	if _, err := io.Copy(io.Discard, r.lr); err != nil {
+		if r.lr.N <= 0 {
+			return errors.Errorf(errors.InvalidParams, "decompressed size exceeds limit: %d bytes", r.max)
+		}
+		return errors.Wrapf(err, errors.InternalServerError, "failed to verify complete %s stream", r.codecName)
+	}
+
+	return nil
+}
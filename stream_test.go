@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressStreamDecompressStream(t *testing.T) {
+	type payload struct {
+		ID   int      `json:"id"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	t.Run("nil data case", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := CompressStream(&buf, nil)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "data cannot be nil"))
+	})
+
+	t.Run("round-trip case", func(t *testing.T) {
+		in := payload{ID: 3, Name: "gamma", Tags: []string{"x", "y"}}
+
+		var buf bytes.Buffer
+		assert.Exactly(t, nil, CompressStream(&buf, in))
+		assert.Exactly(t, true, buf.Len() > 0)
+		assert.Exactly(t, true, bytes.HasPrefix(buf.Bytes(), gzipCodec{}.Magic()))
+
+		var out payload
+		assert.Exactly(t, nil, DecompressStream(&out, bytes.NewReader(buf.Bytes()), 0))
+		assert.Exactly(t, in, out)
+	})
+
+	t.Run("nil output pointer case", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Exactly(t, nil, CompressStream(&buf, "ok"))
+
+		err := DecompressStream(nil, bytes.NewReader(buf.Bytes()), 0)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "output pointer cannot be nil"))
+	})
+
+	t.Run("decode size exceeds limit case", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Exactly(t, nil, CompressStream(&buf, strings.Repeat("a", 100)))
+
+		var s string
+		err := DecompressStream(&s, bytes.NewReader(buf.Bytes()), 10)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "decompressed size exceeds limit: 10 bytes"))
+	})
+
+	t.Run("invalid input case", func(t *testing.T) {
+		var out payload
+		err := DecompressStream(&out, strings.NewReader("not compressed"), 0)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "failed to create gzip reader"))
+	})
+}
+
+func TestNewCompressWriterNewDecompressReader(t *testing.T) {
+	t.Run("nil writer case", func(t *testing.T) {
+		_, err := NewCompressWriter(nil)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "writer cannot be nil"))
+	})
+
+	t.Run("nil reader case", func(t *testing.T) {
+		_, err := NewDecompressReader(nil, 0)
+		assert.Exactly(t, true, err != nil)
+		assert.Exactly(t, true, strings.Contains(err.Error(), "reader cannot be nil"))
+	})
+
+	t.Run("streaming round-trip of raw bytes", func(t *testing.T) {
+		var buf bytes.Buffer
+		cw, err := NewCompressWriter(&buf)
+		assert.Exactly(t, nil, err)
+
+		want := []byte("streamed payload that is not JSON-wrapped")
+		_, err = cw.Write(want)
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, nil, cw.Close())
+
+		cr, err := NewDecompressReader(bytes.NewReader(buf.Bytes()), 0)
+		assert.Exactly(t, nil, err)
+
+		got := make([]byte, len(want))
+		n, err := io.ReadFull(cr, got)
+		assert.Exactly(t, nil, err)
+		assert.Exactly(t, len(want), n)
+		assert.Exactly(t, want, got)
+		assert.Exactly(t, nil, cr.Close())
+	})
+}